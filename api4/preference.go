@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/mattermost/mattermost-server/v6/app"
 	"github.com/mattermost/mattermost-server/v6/audit"
 	"github.com/mattermost/mattermost-server/v6/model"
 	"github.com/mattermost/mattermost-server/v6/shared/mlog"
@@ -16,10 +17,28 @@ func (api *API) InitPreference() {
 	api.BaseRoutes.Preferences.Handle("", api.ApiSessionRequired(getPreferences)).Methods("GET")
 	api.BaseRoutes.Preferences.Handle("", api.ApiSessionRequired(updatePreferences)).Methods("PUT")
 	api.BaseRoutes.Preferences.Handle("/delete", api.ApiSessionRequired(deletePreferences)).Methods("POST")
+	api.BaseRoutes.Preferences.Handle("/schema", api.ApiHandler(getPreferencesSchema)).Methods("GET")
+	api.BaseRoutes.Preferences.Handle("/sync", api.ApiSessionRequired(syncPreferences)).Methods("POST")
 	api.BaseRoutes.Preferences.Handle("/{category:[A-Za-z0-9_]+}", api.ApiSessionRequired(getPreferencesByCategory)).Methods("GET")
 	api.BaseRoutes.Preferences.Handle("/{category:[A-Za-z0-9_]+}/name/{preference_name:[A-Za-z0-9_]+}", api.ApiSessionRequired(getPreferenceByCategoryAndName)).Methods("GET")
 }
 
+// getPreferencesSchema returns every registered PreferenceSchema so clients
+// can validate a preference's value before writing it, instead of finding
+// out it was rejected only after a round trip to updatePreferences.
+func getPreferencesSchema(c *Context, w http.ResponseWriter, r *http.Request) {
+	if err := json.NewEncoder(w).Encode(app.PreferenceSchemas()); err != nil {
+		mlog.Warn("Error while writing response", mlog.Err(err))
+	}
+}
+
+// preferenceValidationError builds the structured 400 returned when one or
+// more preferences fail their registered schema's validation.
+func preferenceValidationError(where string, failures []app.PreferenceValidationFailure) *model.AppError {
+	data, _ := json.Marshal(failures)
+	return model.NewAppError(where, "api.preference.validation.error", map[string]interface{}{"Failures": string(data)}, "", http.StatusBadRequest)
+}
+
 func getPreferences(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireUserId()
 	if c.Err != nil {
@@ -122,9 +141,16 @@ func updatePreferences(c *Context, w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		pref.UpdateAt = model.GetMillis()
 		sanitizedPreferences = append(sanitizedPreferences, pref)
 	}
 
+	if failures := app.ValidatePreferences(sanitizedPreferences); len(failures) > 0 {
+		auditRec.AddMeta("validation_failures", failures)
+		c.Err = preferenceValidationError("Api4.UpdatePreferences", failures)
+		return
+	}
+
 	if err := c.App.UpdatePreferences(c.Params.UserId, sanitizedPreferences); err != nil {
 		c.Err = err
 		return
@@ -134,6 +160,55 @@ func updatePreferences(c *Context, w http.ResponseWriter, r *http.Request) {
 	ReturnStatusOK(w)
 }
 
+// preferenceSyncRequest is the body of POST
+// /users/{user_id}/preferences/sync: a client's cursor (since) plus
+// whatever preferences it changed while offline.
+type preferenceSyncRequest struct {
+	Since       int64             `json:"since"`
+	Preferences model.Preferences `json:"preferences"`
+}
+
+func syncPreferences(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireUserId()
+	if c.Err != nil {
+		return
+	}
+
+	if !c.App.SessionHasPermissionToUser(*c.AppContext.Session(), c.Params.UserId) {
+		c.SetPermissionError(model.PermissionEditOtherUsers)
+		return
+	}
+
+	auditRec := c.MakeAuditRecord("syncPreferences", audit.Fail)
+	defer c.LogAuditRec(auditRec)
+
+	var req preferenceSyncRequest
+	if jsonErr := json.NewDecoder(r.Body).Decode(&req); jsonErr != nil {
+		c.SetInvalidParam("preferences_sync")
+		return
+	}
+	auditRec.AddMeta("since", req.Since)
+
+	if failures := app.ValidatePreferences(req.Preferences); len(failures) > 0 {
+		auditRec.AddMeta("validation_failures", failures)
+		c.Err = preferenceValidationError("Api4.SyncPreferences", failures)
+		return
+	}
+
+	result, err := c.App.SyncPreferences(c.Params.UserId, req.Since, req.Preferences)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	auditRec.Success()
+	auditRec.AddMeta("new_since", result.NewSince)
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		mlog.Warn("Error while writing response", mlog.Err(err))
+	}
+}
+
 func deletePreferences(c *Context, w http.ResponseWriter, r *http.Request) {
 	c.RequireUserId()
 	if c.Err != nil {
@@ -4,8 +4,11 @@
 package api4
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/mattermost/mattermost-server/v6/audit"
 	"github.com/mattermost/mattermost-server/v6/model"
@@ -20,6 +23,9 @@ func (api *API) InitScheme() {
 	api.BaseRoutes.Schemes.Handle("/{scheme_id:[A-Za-z0-9]+}/patch", api.ApiSessionRequired(patchScheme)).Methods("PUT")
 	api.BaseRoutes.Schemes.Handle("/{scheme_id:[A-Za-z0-9]+}/teams", api.ApiSessionRequiredTrustRequester(getTeamsForScheme)).Methods("GET")
 	api.BaseRoutes.Schemes.Handle("/{scheme_id:[A-Za-z0-9]+}/channels", api.ApiSessionRequiredTrustRequester(getChannelsForScheme)).Methods("GET")
+	api.BaseRoutes.Schemes.Handle("/{scheme_id:[A-Za-z0-9]+}/export", api.ApiSessionRequired(exportScheme)).Methods("POST")
+	api.BaseRoutes.Schemes.Handle("/import", api.ApiSessionRequired(importScheme)).Methods("POST")
+	api.BaseRoutes.Schemes.Handle("/{scheme_id:[A-Za-z0-9]+}/diff", api.ApiSessionRequired(diffScheme)).Methods("POST")
 }
 
 func createScheme(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -242,3 +248,291 @@ func deleteScheme(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	ReturnStatusOK(w)
 }
+
+// schemeBundleSchemaVersion is bumped whenever the shape of schemeBundle
+// changes in a way that's not backwards compatible with importScheme.
+const schemeBundleSchemaVersion = 1
+
+// schemeBundle is the portable, self-contained representation of a scheme
+// used by exportScheme/importScheme/diffScheme to move a custom permissions
+// scheme between servers. It carries every role the scheme references in
+// full, not just their IDs, since role IDs aren't portable across servers.
+type schemeBundle struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Scheme        *model.Scheme          `json:"scheme"`
+	Roles         map[string]*model.Role `json:"roles"`
+}
+
+// schemeRoleNames returns the scheme's default role names keyed by the same
+// key schemeBundle.Roles uses, so export/import/diff agree on role identity
+// without relying on server-specific role IDs.
+func schemeRoleNames(scheme *model.Scheme) map[string]string {
+	names := map[string]string{
+		"default_team_admin_role":    scheme.DefaultTeamAdminRole,
+		"default_team_user_role":     scheme.DefaultTeamUserRole,
+		"default_team_guest_role":    scheme.DefaultTeamGuestRole,
+		"default_channel_admin_role": scheme.DefaultChannelAdminRole,
+		"default_channel_user_role":  scheme.DefaultChannelUserRole,
+		"default_channel_guest_role": scheme.DefaultChannelGuestRole,
+	}
+
+	if scheme.Scope == model.SchemeScopeTeam {
+		delete(names, "default_channel_admin_role")
+		delete(names, "default_channel_user_role")
+		delete(names, "default_channel_guest_role")
+	}
+
+	return names
+}
+
+func buildSchemeBundle(c *Context, scheme *model.Scheme) (*schemeBundle, *model.AppError) {
+	bundle := &schemeBundle{
+		SchemaVersion: schemeBundleSchemaVersion,
+		Scheme:        scheme,
+		Roles:         map[string]*model.Role{},
+	}
+
+	for key, roleName := range schemeRoleNames(scheme) {
+		if roleName == "" {
+			continue
+		}
+
+		role, err := c.App.GetRoleByName(context.Background(), roleName)
+		if err != nil {
+			return nil, err
+		}
+
+		bundle.Roles[key] = role
+	}
+
+	return bundle, nil
+}
+
+// unknownBundlePermissions returns the subset of perms that this server
+// does not recognize, so importScheme can refuse a bundle that references
+// permissions which don't exist on the target server instead of silently
+// dropping them. diffScheme does not check for unknown permissions.
+func unknownBundlePermissions(perms []string) []string {
+	known := make(map[string]bool, len(model.AllPermissions))
+	for _, p := range model.AllPermissions {
+		known[p.Id] = true
+	}
+
+	var unknown []string
+	for _, p := range perms {
+		if !known[p] {
+			unknown = append(unknown, p)
+		}
+	}
+
+	return unknown
+}
+
+func exportScheme(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireSchemeId()
+	if c.Err != nil {
+		return
+	}
+
+	auditRec := c.MakeAuditRecord("exportScheme", audit.Fail)
+	defer c.LogAuditRec(auditRec)
+	auditRec.AddMeta("scheme_id", c.Params.SchemeId)
+
+	if c.App.Srv().License() == nil || !*c.App.Srv().License().Features.CustomPermissionsSchemes {
+		c.Err = model.NewAppError("Api4.ExportScheme", "api.scheme.export_scheme.license.error", nil, "", http.StatusNotImplemented)
+		return
+	}
+
+	if !c.App.SessionHasPermissionTo(*c.AppContext.Session(), model.PermissionSysconsoleWriteUserManagementPermissions) {
+		c.SetPermissionError(model.PermissionSysconsoleWriteUserManagementPermissions)
+		return
+	}
+
+	scheme, err := c.App.GetScheme(c.Params.SchemeId)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	bundle, err := buildSchemeBundle(c, scheme)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	auditRec.Success()
+	auditRec.AddMeta("bundle", bundle)
+
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		mlog.Warn("Error while writing response", mlog.Err(err))
+	}
+}
+
+func importScheme(c *Context, w http.ResponseWriter, r *http.Request) {
+	auditRec := c.MakeAuditRecord("importScheme", audit.Fail)
+	defer c.LogAuditRec(auditRec)
+
+	if c.App.Srv().License() == nil || !*c.App.Srv().License().Features.CustomPermissionsSchemes {
+		c.Err = model.NewAppError("Api4.ImportScheme", "api.scheme.import_scheme.license.error", nil, "", http.StatusNotImplemented)
+		return
+	}
+
+	if !c.App.SessionHasPermissionTo(*c.AppContext.Session(), model.PermissionSysconsoleWriteUserManagementPermissions) {
+		c.SetPermissionError(model.PermissionSysconsoleWriteUserManagementPermissions)
+		return
+	}
+
+	var bundle schemeBundle
+	if jsonErr := json.NewDecoder(r.Body).Decode(&bundle); jsonErr != nil || bundle.Scheme == nil {
+		c.SetInvalidParam("scheme_bundle")
+		return
+	}
+	auditRec.AddMeta("bundle", bundle)
+
+	if bundle.SchemaVersion > schemeBundleSchemaVersion {
+		c.Err = model.NewAppError("Api4.ImportScheme", "api.scheme.import_scheme.schema_version.error", map[string]interface{}{"Version": bundle.SchemaVersion}, "", http.StatusBadRequest)
+		return
+	}
+
+	var unknown []string
+	for key, role := range bundle.Roles {
+		if bad := unknownBundlePermissions(role.Permissions); len(bad) > 0 {
+			unknown = append(unknown, fmt.Sprintf("%s: %s", key, strings.Join(bad, ", ")))
+		}
+	}
+	if len(unknown) > 0 {
+		c.Err = model.NewAppError("Api4.ImportScheme", "api.scheme.import_scheme.unknown_permissions.error", map[string]interface{}{"Roles": strings.Join(unknown, "; ")}, "", http.StatusBadRequest)
+		return
+	}
+
+	incoming := bundle.Scheme
+	scheme := &model.Scheme{
+		Name:        incoming.Name,
+		DisplayName: incoming.DisplayName,
+		Description: incoming.Description,
+		Scope:       incoming.Scope,
+	}
+
+	scheme, err := c.App.CreateScheme(scheme)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	for key, roleName := range schemeRoleNames(scheme) {
+		bundledRole, ok := bundle.Roles[key]
+		if !ok || roleName == "" {
+			continue
+		}
+
+		role, err := c.App.GetRoleByName(context.Background(), roleName)
+		if err != nil {
+			c.Err = err
+			_, _ = c.App.DeleteScheme(scheme.Id)
+			return
+		}
+
+		permissions := bundledRole.Permissions
+		role, err = c.App.PatchRole(role, &model.RolePatch{Permissions: &permissions})
+		if err != nil {
+			c.Err = err
+			_, _ = c.App.DeleteScheme(scheme.Id)
+			return
+		}
+		bundle.Roles[key] = role
+	}
+
+	auditRec.Success()
+	auditRec.AddMeta("scheme", scheme)
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(scheme); err != nil {
+		mlog.Warn("Error while writing response", mlog.Err(err))
+	}
+}
+
+// schemeRolePermissionDiff is the symmetric difference between a bundle's
+// role permissions and what's currently stored for that role.
+type schemeRolePermissionDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+func diffScheme(c *Context, w http.ResponseWriter, r *http.Request) {
+	c.RequireSchemeId()
+	if c.Err != nil {
+		return
+	}
+
+	auditRec := c.MakeAuditRecord("diffScheme", audit.Fail)
+	defer c.LogAuditRec(auditRec)
+	auditRec.AddMeta("scheme_id", c.Params.SchemeId)
+
+	if c.App.Srv().License() == nil || !*c.App.Srv().License().Features.CustomPermissionsSchemes {
+		c.Err = model.NewAppError("Api4.DiffScheme", "api.scheme.diff_scheme.license.error", nil, "", http.StatusNotImplemented)
+		return
+	}
+
+	if !c.App.SessionHasPermissionTo(*c.AppContext.Session(), model.PermissionSysconsoleWriteUserManagementPermissions) {
+		c.SetPermissionError(model.PermissionSysconsoleWriteUserManagementPermissions)
+		return
+	}
+
+	scheme, err := c.App.GetScheme(c.Params.SchemeId)
+	if err != nil {
+		c.Err = err
+		return
+	}
+
+	var bundle schemeBundle
+	if jsonErr := json.NewDecoder(r.Body).Decode(&bundle); jsonErr != nil || bundle.Scheme == nil {
+		c.SetInvalidParam("scheme_bundle")
+		return
+	}
+
+	diff := map[string]schemeRolePermissionDiff{}
+	for key, roleName := range schemeRoleNames(scheme) {
+		bundledRole, ok := bundle.Roles[key]
+		if !ok || roleName == "" {
+			continue
+		}
+
+		storedRole, err := c.App.GetRoleByName(context.Background(), roleName)
+		if err != nil {
+			c.Err = err
+			return
+		}
+
+		stored := make(map[string]bool, len(storedRole.Permissions))
+		for _, p := range storedRole.Permissions {
+			stored[p] = true
+		}
+		incoming := make(map[string]bool, len(bundledRole.Permissions))
+		for _, p := range bundledRole.Permissions {
+			incoming[p] = true
+		}
+
+		var d schemeRolePermissionDiff
+		for p := range incoming {
+			if !stored[p] {
+				d.Added = append(d.Added, p)
+			}
+		}
+		for p := range stored {
+			if !incoming[p] {
+				d.Removed = append(d.Removed, p)
+			}
+		}
+
+		if len(d.Added) > 0 || len(d.Removed) > 0 {
+			diff[key] = d
+		}
+	}
+
+	auditRec.Success()
+	auditRec.AddMeta("diff", diff)
+
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		mlog.Warn("Error while writing response", mlog.Err(err))
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// PreferenceValidator checks whether a preference's value is well-formed. It
+// receives the full Preference, not just Value, since some categories key
+// validation off Name as well (e.g. flagged_post's Name is a post ID).
+type PreferenceValidator func(pref *model.Preference) error
+
+// PreferenceSchema describes the shape core code or a plugin expects a
+// preference's value to have, so updatePreferences and syncPreferences can
+// reject malformed writes before they ever reach the store.
+// deletePreferences does not check values against it.
+type PreferenceSchema struct {
+	// Category this schema applies to.
+	Category string `json:"category"`
+	// Name restricts the schema to a single preference name within
+	// Category. Empty matches every name in the category.
+	Name string `json:"name,omitempty"`
+	// JSONSchema is an optional JSON Schema document describing Value,
+	// returned verbatim by GET /preferences/schema so clients can validate
+	// before ever sending a write. Server-side enforcement goes through
+	// Validator, not this field.
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"`
+	// MaxValueBytes caps len(Value). Zero means no limit beyond the store's
+	// own column limit.
+	MaxValueBytes int `json:"max_value_bytes,omitempty"`
+	// Validator is run against every write for this category/name. It may
+	// be nil for schemas that only exist to publish JSONSchema to clients.
+	Validator PreferenceValidator `json:"-"`
+}
+
+func (s *PreferenceSchema) key() string {
+	return s.Category + "\x00" + s.Name
+}
+
+var preferenceSchemaRegistry = map[string]*PreferenceSchema{}
+
+// RegisterPreferenceSchema adds or replaces the schema for schema.Category
+// (and optionally schema.Name). Core packages register their schemas from
+// init(); any other package, such as a plugin, can call it the same way to
+// add its own.
+func RegisterPreferenceSchema(schema *PreferenceSchema) {
+	preferenceSchemaRegistry[schema.key()] = schema
+}
+
+// PreferenceSchemas returns every registered schema, for GET
+// /preferences/schema.
+func PreferenceSchemas() []*PreferenceSchema {
+	schemas := make([]*PreferenceSchema, 0, len(preferenceSchemaRegistry))
+	for _, s := range preferenceSchemaRegistry {
+		schemas = append(schemas, s)
+	}
+
+	return schemas
+}
+
+func lookupPreferenceSchema(category, name string) *PreferenceSchema {
+	if s, ok := preferenceSchemaRegistry[category+"\x00"+name]; ok {
+		return s
+	}
+	if s, ok := preferenceSchemaRegistry[category+"\x00"]; ok {
+		return s
+	}
+
+	return nil
+}
+
+// PreferenceValidationFailure is one offending preference, surfaced back to
+// the client by updatePreferences and syncPreferences.
+type PreferenceValidationFailure struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Reason   string `json:"reason"`
+}
+
+// ValidatePreferences checks every preference against its registered schema,
+// if any, and returns one PreferenceValidationFailure per offending entry.
+// A preference with no registered schema for its category/name is allowed
+// through unchanged, same as before this registry existed.
+func ValidatePreferences(preferences model.Preferences) []PreferenceValidationFailure {
+	var failures []PreferenceValidationFailure
+
+	for _, pref := range preferences {
+		schema := lookupPreferenceSchema(pref.Category, pref.Name)
+		if schema == nil {
+			continue
+		}
+
+		if schema.MaxValueBytes > 0 && len(pref.Value) > schema.MaxValueBytes {
+			failures = append(failures, PreferenceValidationFailure{
+				Category: pref.Category,
+				Name:     pref.Name,
+				Reason:   fmt.Sprintf("value exceeds maximum length of %d bytes", schema.MaxValueBytes),
+			})
+			continue
+		}
+
+		if schema.Validator == nil {
+			continue
+		}
+
+		if err := schema.Validator(&pref); err != nil {
+			failures = append(failures, PreferenceValidationFailure{
+				Category: pref.Category,
+				Name:     pref.Name,
+				Reason:   err.Error(),
+			})
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// Built-in schemas for the categories that used to validate their values
+// (if at all) deep inside whichever consumer happened to read them back
+// out. Centralizing them here means a malformed write is rejected at
+// updatePreferences instead of surfacing as a crash in some unrelated
+// reader months later.
+func init() {
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category:      model.PreferenceCategoryFlaggedPost,
+		JSONSchema:    json.RawMessage(`{"type":"string","enum":["true","false"]}`),
+		MaxValueBytes: 8,
+		Validator:     validateBooleanPreferenceValue,
+	})
+
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category:      model.PreferenceCategoryDirectChannelShow,
+		JSONSchema:    json.RawMessage(`{"type":"string","enum":["true","false"]}`),
+		MaxValueBytes: 8,
+		Validator:     validateBooleanPreferenceValue,
+	})
+
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category:      model.PreferenceCategoryTheme,
+		JSONSchema:    json.RawMessage(`{"type":"object"}`),
+		MaxValueBytes: 16 * 1024,
+		Validator:     validateJSONObjectPreferenceValue,
+	})
+
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category:      model.PreferenceCategorySidebarSettings,
+		JSONSchema:    json.RawMessage(`{"type":"object"}`),
+		MaxValueBytes: 16 * 1024,
+		Validator:     validateJSONObjectPreferenceValue,
+	})
+
+	// Notification settings live on User.NotifyProps, not as a preference
+	// category, so there is no PreferenceCategoryNotifications to register
+	// a schema for here.
+}
+
+func validateBooleanPreferenceValue(pref *model.Preference) error {
+	if pref.Value != "true" && pref.Value != "false" {
+		return errors.New(`value must be "true" or "false"`)
+	}
+
+	return nil
+}
+
+func validateJSONObjectPreferenceValue(pref *model.Preference) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(pref.Value), &v); err != nil || v == nil {
+		return errors.New("value must be a JSON object")
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePreferencesBuiltinSchemas(t *testing.T) {
+	preferences := model.Preferences{
+		{Category: model.PreferenceCategoryFlaggedPost, Name: "post123", Value: "true"},
+		{Category: model.PreferenceCategoryFlaggedPost, Name: "post456", Value: "not-a-bool"},
+		{Category: model.PreferenceCategoryTheme, Name: "", Value: `{"sidebarBg":"#fff"}`},
+		{Category: model.PreferenceCategoryTheme, Name: "", Value: `not json`},
+		{Category: "unregistered_category", Name: "whatever", Value: "anything goes"},
+	}
+
+	failures := ValidatePreferences(preferences)
+	require.Len(t, failures, 2)
+	require.Equal(t, "post456", failures[0].Name)
+	require.Equal(t, model.PreferenceCategoryTheme, failures[1].Category)
+}
+
+func TestRegisterPreferenceSchemaNameOverridesCategory(t *testing.T) {
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category: "test_category",
+		Validator: func(pref *model.Preference) error {
+			return nil
+		},
+	})
+	RegisterPreferenceSchema(&PreferenceSchema{
+		Category: "test_category",
+		Name:     "specific",
+		MaxValueBytes: 2,
+	})
+	defer delete(preferenceSchemaRegistry, (&PreferenceSchema{Category: "test_category"}).key())
+	defer delete(preferenceSchemaRegistry, (&PreferenceSchema{Category: "test_category", Name: "specific"}).key())
+
+	failures := ValidatePreferences(model.Preferences{
+		{Category: "test_category", Name: "specific", Value: "too long"},
+	})
+	require.Len(t, failures, 1)
+}
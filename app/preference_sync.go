@@ -0,0 +1,115 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package app
+
+import (
+	"encoding/json"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+)
+
+// PreferenceSyncResult is the response to a POST
+// /users/{user_id}/preferences/sync request.
+type PreferenceSyncResult struct {
+	ServerChanges model.Preferences `json:"server_changes"`
+	Conflicts     model.Preferences `json:"conflicts"`
+	NewSince      int64             `json:"new_since"`
+}
+
+// SyncPreferences reconciles a client's offline preference changes against
+// what's currently stored for the user using last-writer-wins-with-
+// conflict-surface semantics: a submitted preference is applied if the
+// client's view (pref.UpdateAt) is at least as new as what's stored;
+// otherwise the stored value wins and is reported back in Conflicts rather
+// than silently discarding the client's edit. Any preference changed on the
+// server since the client's cursor is returned in ServerChanges so the
+// client can pull deltas down instead of refetching its whole preference
+// set, and other sessions for the user are notified over the websocket so
+// they can do the same.
+//
+// UpdateAt is always stamped here with the server's own clock, never taken
+// from the client: submitted.UpdateAt is only ever read (to compare against
+// what's stored), never trusted as the value to persist or to advance
+// NewSince. NewSince starts from the client's own since and only moves
+// forward from there, to the newest UpdateAt the server has stored or just
+// wrote.
+func (a *App) SyncPreferences(userID string, since int64, submitted model.Preferences) (*PreferenceSyncResult, *model.AppError) {
+	stored, appErr := a.GetPreferencesForUser(userID)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	storedByKey := make(map[string]model.Preference, len(stored))
+	for _, p := range stored {
+		storedByKey[p.Category+"\x00"+p.Name] = p
+	}
+
+	result := &PreferenceSyncResult{NewSince: since}
+	now := model.GetMillis()
+
+	var toApply model.Preferences
+	for _, p := range submitted {
+		if existing, ok := storedByKey[p.Category+"\x00"+p.Name]; ok && existing.UpdateAt > p.UpdateAt {
+			result.Conflicts = append(result.Conflicts, existing)
+			continue
+		}
+
+		p.UpdateAt = now
+		toApply = append(toApply, p)
+	}
+
+	if len(toApply) > 0 {
+		if appErr := a.UpdatePreferences(userID, toApply); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	applied := make(map[string]bool, len(toApply))
+	for _, p := range toApply {
+		applied[p.Category+"\x00"+p.Name] = true
+	}
+
+	for _, p := range stored {
+		if applied[p.Category+"\x00"+p.Name] {
+			// Already reflected in toApply with the value the client just
+			// submitted; echoing the stale pre-write copy here would make
+			// the client's own edit look like a server-side conflict.
+			continue
+		}
+
+		if p.UpdateAt <= since {
+			continue
+		}
+
+		result.ServerChanges = append(result.ServerChanges, p)
+		if p.UpdateAt > result.NewSince {
+			result.NewSince = p.UpdateAt
+		}
+	}
+
+	if len(toApply) > 0 && now > result.NewSince {
+		result.NewSince = now
+	}
+
+	a.publishPreferenceSyncEvent(userID, result)
+
+	return result, nil
+}
+
+// publishPreferenceSyncEvent lets a user's other connected sessions know
+// there's new preference state as of result.NewSince, so they can call
+// POST /preferences/sync with their own cursor to pull the deltas down. It
+// deliberately uses its own event rather than WebsocketEventPreferencesChanged:
+// that event's existing consumers expect the full preference set as their
+// payload, and only the changed subset is known here.
+func (a *App) publishPreferenceSyncEvent(userID string, result *PreferenceSyncResult) {
+	message := model.NewWebSocketEvent(model.WebsocketEventPreferencesSync, "", "", userID, nil, "")
+	message.Add("new_since", result.NewSince)
+
+	if changed, err := json.Marshal(result.ServerChanges); err == nil {
+		message.Add("preferences", string(changed))
+	}
+
+	a.Publish(message)
+}
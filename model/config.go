@@ -0,0 +1,81 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// passwordAuthProviderHTTP mirrors users.PasswordAuthProviderHTTP. It's
+// duplicated as an unexported literal here, rather than imported, because
+// model is a leaf package services/users depends on.
+const passwordAuthProviderHTTP = "http"
+
+type ServiceSettings struct {
+	EnableDeveloper *bool
+
+	// PasswordAuthProvider selects the services/users.PasswordAuthenticator
+	// CheckUserPassword uses ("bcrypt", "http", or a provider registered by
+	// an einterfaces plugin via RegisterPasswordAuthProvider). Defaults to
+	// "bcrypt" when unset.
+	PasswordAuthProvider *string
+	// PasswordAuthFallbackToLocal, when the configured provider reports a
+	// transient failure, allows CheckUserPassword to fall back to comparing
+	// against the local bcrypt hash rather than erroring out.
+	PasswordAuthFallbackToLocal *bool
+
+	// The following only apply when PasswordAuthProvider is "http".
+	PasswordAuthHTTPURL            *string
+	PasswordAuthHTTPBearerToken    *string
+	PasswordAuthHTTPTimeoutSeconds *int
+	PasswordAuthHTTPClientCertFile *string
+	PasswordAuthHTTPClientKeyFile  *string
+}
+
+type PasswordSettings struct {
+	MinimumLength *int
+	Lowercase     *bool
+	Uppercase     *bool
+	Number        *bool
+	Symbol        *bool
+}
+
+type Config struct {
+	ServiceSettings  ServiceSettings
+	PasswordSettings PasswordSettings
+}
+
+// IsValid performs a basic sanity check on the configuration, returning the
+// first problem found.
+func (o *Config) IsValid() *AppError {
+	return o.ServiceSettings.isValid()
+}
+
+func (s *ServiceSettings) isValid() *AppError {
+	if s.PasswordAuthProvider == nil || *s.PasswordAuthProvider != passwordAuthProviderHTTP {
+		return nil
+	}
+
+	if s.PasswordAuthHTTPURL == nil || *s.PasswordAuthHTTPURL == "" {
+		return NewAppError("Config.IsValid", "model.config.is_valid.password_auth_http_url.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	parsed, err := url.ParseRequestURI(*s.PasswordAuthHTTPURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return NewAppError("Config.IsValid", "model.config.is_valid.password_auth_http_url.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	if s.PasswordAuthHTTPTimeoutSeconds != nil && *s.PasswordAuthHTTPTimeoutSeconds <= 0 {
+		return NewAppError("Config.IsValid", "model.config.is_valid.password_auth_http_timeout.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	certSet := s.PasswordAuthHTTPClientCertFile != nil && *s.PasswordAuthHTTPClientCertFile != ""
+	keySet := s.PasswordAuthHTTPClientKeyFile != nil && *s.PasswordAuthHTTPClientKeyFile != ""
+	if certSet != keySet {
+		return NewAppError("Config.IsValid", "model.config.is_valid.password_auth_http_mtls.app_error", nil, "", http.StatusBadRequest)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	PreferenceCategoryDirectChannelShow = "direct_channel_show"
+	PreferenceCategoryTheme             = "theme"
+	PreferenceCategoryFlaggedPost       = "flagged_post"
+	PreferenceCategorySidebarSettings   = "sidebar_settings"
+)
+
+// Preference is a per-user setting keyed by Category and Name, used for
+// everything from UI theme to which channels are muted.
+type Preference struct {
+	UserId   string `json:"user_id"`
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	// UpdateAt is stamped by the caller immediately before a write (see
+	// api4.updatePreferences and app.SyncPreferences) and is the basis for
+	// last-writer-wins conflict resolution in multi-device sync (see
+	// app.SyncPreferences). Clients should treat it as opaque and
+	// server-authoritative rather than setting it themselves.
+	UpdateAt int64 `json:"update_at"`
+}
+
+type Preferences []Preference
+
+// PreferencesFromJson decodes a JSON array of Preference from data.
+func PreferencesFromJson(data io.Reader) (Preferences, error) {
+	var preferences Preferences
+	err := json.NewDecoder(data).Decode(&preferences)
+	return preferences, err
+}
@@ -0,0 +1,13 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+import "time"
+
+// GetMillis returns the current time in milliseconds since the epoch,
+// the unit every *At timestamp field in this package (CreateAt, UpdateAt,
+// DeleteAt, ...) is stored in.
+func GetMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
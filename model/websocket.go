@@ -0,0 +1,20 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package model
+
+const (
+	// WebsocketEventPreferencesChanged is sent with the full updated
+	// Preferences payload whenever a user's preferences are written via the
+	// plain PUT /preferences path.
+	WebsocketEventPreferencesChanged = "preferences_changed"
+
+	// WebsocketEventPreferencesSync tells a user's other sessions that new
+	// preference state exists as of new_since, so they can call
+	// POST /preferences/sync with their own cursor to pull deltas instead
+	// of refetching everything. It intentionally does not reuse
+	// WebsocketEventPreferencesChanged's payload shape (a full Preferences
+	// array keyed by that event's existing consumers) since only the
+	// subset of preferences that actually changed is known here.
+	WebsocketEventPreferencesSync = "preferences_sync"
+)
@@ -4,33 +4,85 @@
 package users
 
 import (
-	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"strings"
-	"encoding/json"
-	"net/http"
+	"time"
 
 	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/shared/mlog"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// func CheckUserPassword(user *model.User, password string) error {
-// 	if err := ComparePassword(user.Password, password); err != nil {
-// 		return NewErrInvalidPassword("")
-// 	}
+// CheckUserPassword validates password against user's configured
+// PasswordAuthProvider (bcrypt by default), falling back to local bcrypt
+// when the primary provider is unavailable and PasswordAuthFallbackToLocal
+// is enabled. A transient provider failure (e.g. an IAM outage) is
+// surfaced as an error rather than NewErrInvalidPassword, so callers don't
+// lock users out of accounts they otherwise have valid credentials for.
+//
+// PasswordSettings complexity is only enforced ahead of the http provider,
+// per its "validated ... before making the remote call" contract: running
+// it against bcrypt (local, and the fallback path) would lock existing
+// users out of otherwise-valid accounts whose stored password predates a
+// policy tightened after the fact.
+func (us *UserService) CheckUserPassword(user *model.User, password string) error {
+	authenticator, err := us.passwordAuthenticator()
+	if err != nil {
+		return err
+	}
+
+	if _, isHTTP := authenticator.(*httpAuthenticator); isHTTP {
+		if err := us.isPasswordValid(password); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, authErr := authenticator.Authenticate(ctx, user.Username, password, user)
+	if authErr != nil && result.Transient {
+		provider := PasswordAuthProviderBcrypt
+		if p := us.config().ServiceSettings.PasswordAuthProvider; p != nil {
+			provider = PasswordAuthProvider(*p)
+		}
+
+		if provider != PasswordAuthProviderBcrypt && us.config().ServiceSettings.PasswordAuthFallbackToLocal != nil &&
+			*us.config().ServiceSettings.PasswordAuthFallbackToLocal {
+			mlog.Warn("users: password auth provider unavailable, falling back to local bcrypt", mlog.String("provider", string(provider)), mlog.Err(authErr))
+			result, authErr = bcryptAuthenticator{}.Authenticate(ctx, user.Username, password, user)
+		} else {
+			us.auditPasswordCheck(user, false, authErr)
+			return fmt.Errorf("users: password auth provider unavailable: %w", authErr)
+		}
+	}
+
+	if authErr != nil {
+		us.auditPasswordCheck(user, false, authErr)
+		return NewErrInvalidPassword("")
+	}
 
-// 	return nil
-// }
+	us.auditPasswordCheck(user, result.Ok, nil)
 
-// change CheckUserPassword function above with this code below
-func CheckUserPassword(user *model.User, password string) error {
-	if err := ValidateIAM(user.Username, password); err != true {
+	if !result.Ok {
 		return NewErrInvalidPassword("")
 	}
 
 	return nil
 }
 
+// auditPasswordCheck logs the outcome of a password check attempt. The
+// services/users package has no request Context to attach a full
+// audit.Record to, so callers that need a durable audit trail (api4's
+// login handler, which owns the Context) are expected to create their own
+// audit record around the CheckUserPassword call; this log line exists so
+// an attempt is never silently dropped even when they don't.
+func (us *UserService) auditPasswordCheck(user *model.User, success bool, authErr error) {
+	mlog.Info("users: password check", mlog.String("user_id", user.Id), mlog.Bool("success", success), mlog.Err(authErr))
+}
+
 // HashPassword generates a hash using the bcrypt.GenerateFromPassword
 func HashPassword(password string) string {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
@@ -49,25 +101,6 @@ func ComparePassword(hash string, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func ValidateIAM(username string, password string) bool {
-	rb, err := json.Marshal(map[string]string{
-		"username": username,
-		"password": password,
-	})
-
-	resp, err := http.Post("https://iam.pajak.or.id/api/authentication", "application/json", bytes.NewBuffer(rb))
-	
-	if err != nil {
-		return false
-	}
-
-	if resp.StatusCode == 200 {
-		return true
-	}
-
-	return false
-}
-
 func (us *UserService) isPasswordValid(password string) error {
 
 	if *us.config().ServiceSettings.EnableDeveloper {
@@ -0,0 +1,231 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package users
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/mattermost/mattermost-server/v6/shared/mlog"
+)
+
+// PasswordAuthProvider identifies which PasswordAuthenticator implementation
+// CheckUserPassword should use, as configured via
+// ServiceSettings.PasswordAuthProvider.
+type PasswordAuthProvider string
+
+const (
+	PasswordAuthProviderBcrypt PasswordAuthProvider = "bcrypt"
+	PasswordAuthProviderHTTP   PasswordAuthProvider = "http"
+	PasswordAuthProviderLDAP   PasswordAuthProvider = "ldap-bind"
+)
+
+// AuthResult is the outcome of a single PasswordAuthenticator.Authenticate
+// call.
+type AuthResult struct {
+	// Ok is true when the supplied credentials were accepted.
+	Ok bool
+	// Transient is true when the provider could not reach a verdict because
+	// of an infrastructure problem (timeout, 5xx, network error) rather than
+	// the credentials themselves. CheckUserPassword must not treat a
+	// transient failure as an invalid password.
+	Transient bool
+	// ProviderUserID is the external identifier the provider has for this
+	// user, if it returned one.
+	ProviderUserID string
+	// Claims are optional provider-supplied values to merge into the
+	// resulting session (e.g. roles synced from an IdP).
+	Claims map[string]string
+}
+
+// PasswordAuthenticator validates a username/password pair against some
+// backing credential store. Implementations must not mutate user.
+type PasswordAuthenticator interface {
+	Authenticate(ctx context.Context, username, password string, user *model.User) (AuthResult, error)
+}
+
+// PasswordAuthProviderFactory builds a PasswordAuthenticator for the given
+// UserService. It is called lazily, once per CheckUserPassword call, so the
+// authenticator always sees the current configuration.
+type PasswordAuthProviderFactory func(us *UserService) PasswordAuthenticator
+
+var passwordAuthProviderRegistry = map[PasswordAuthProvider]PasswordAuthProviderFactory{
+	PasswordAuthProviderBcrypt: func(us *UserService) PasswordAuthenticator {
+		return bcryptAuthenticator{}
+	},
+	PasswordAuthProviderHTTP: func(us *UserService) PasswordAuthenticator {
+		return newHTTPAuthenticator(&us.config().ServiceSettings)
+	},
+}
+
+// RegisterPasswordAuthProvider lets an einterfaces implementation (LDAP,
+// SAML, or any other enterprise/plugin package) register a
+// PasswordAuthenticator under a provider name so it can be selected via
+// ServiceSettings.PasswordAuthProvider. It is expected to be called from the
+// registering package's init().
+func RegisterPasswordAuthProvider(name PasswordAuthProvider, factory PasswordAuthProviderFactory) {
+	passwordAuthProviderRegistry[name] = factory
+}
+
+func (us *UserService) passwordAuthenticator() (PasswordAuthenticator, error) {
+	provider := PasswordAuthProviderBcrypt
+	if p := us.config().ServiceSettings.PasswordAuthProvider; p != nil && *p != "" {
+		provider = PasswordAuthProvider(*p)
+	}
+
+	factory, ok := passwordAuthProviderRegistry[provider]
+	if !ok {
+		return nil, fmt.Errorf("users: no PasswordAuthenticator registered for provider %q", provider)
+	}
+
+	return factory(us), nil
+}
+
+// bcryptAuthenticator is the historical, always-available authenticator: it
+// compares the supplied password against the bcrypt hash stored on the user.
+type bcryptAuthenticator struct{}
+
+func (bcryptAuthenticator) Authenticate(_ context.Context, _ string, password string, user *model.User) (AuthResult, error) {
+	if err := ComparePassword(user.Password, password); err != nil {
+		return AuthResult{Ok: false}, nil
+	}
+
+	return AuthResult{Ok: true, ProviderUserID: user.Id}, nil
+}
+
+// httpAuthRequest is the JSON body POSTed to the configured authentication
+// endpoint.
+type httpAuthRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// httpAuthResponse is the JSON body expected back from the endpoint on a
+// 200 response.
+type httpAuthResponse struct {
+	Ok             bool              `json:"ok"`
+	ProviderUserID string            `json:"provider_user_id"`
+	Claims         map[string]string `json:"claims"`
+}
+
+// httpAuthenticator delegates authentication to a remote HTTP(S) JSON
+// endpoint, configured via ServiceSettings rather than hardcoded.
+type httpAuthenticator struct {
+	client      *http.Client
+	url         string
+	bearerToken string
+	maxRetries  int
+}
+
+func newHTTPAuthenticator(settings *model.ServiceSettings) *httpAuthenticator {
+	timeout := 5 * time.Second
+	if settings.PasswordAuthHTTPTimeoutSeconds != nil {
+		timeout = time.Duration(*settings.PasswordAuthHTTPTimeoutSeconds) * time.Second
+	}
+
+	transport := &http.Transport{}
+	if settings.PasswordAuthHTTPClientCertFile != nil && settings.PasswordAuthHTTPClientKeyFile != nil &&
+		*settings.PasswordAuthHTTPClientCertFile != "" && *settings.PasswordAuthHTTPClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(*settings.PasswordAuthHTTPClientCertFile, *settings.PasswordAuthHTTPClientKeyFile)
+		if err != nil {
+			mlog.Error("users: failed to load mTLS client certificate for PasswordAuthProvider http, falling back to system cert pool", mlog.Err(err))
+		} else {
+			transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+	}
+
+	a := &httpAuthenticator{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+		},
+		maxRetries: 2,
+	}
+
+	if settings.PasswordAuthHTTPURL != nil {
+		a.url = *settings.PasswordAuthHTTPURL
+	}
+	if settings.PasswordAuthHTTPBearerToken != nil {
+		a.bearerToken = *settings.PasswordAuthHTTPBearerToken
+	}
+
+	return a
+}
+
+func (a *httpAuthenticator) Authenticate(ctx context.Context, username, password string, _ *model.User) (AuthResult, error) {
+	if a.url == "" {
+		return AuthResult{}, fmt.Errorf("users: PasswordAuthProvider http requires ServiceSettings.PasswordAuthHTTPURL to be set")
+	}
+
+	body, err := json.Marshal(httpAuthRequest{Username: username, Password: password})
+	if err != nil {
+		return AuthResult{}, fmt.Errorf("users: failed to marshal http auth request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= a.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return AuthResult{Transient: true}, ctx.Err()
+			case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+			}
+		}
+
+		result, transient, err := a.doRequest(ctx, body)
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		if !transient {
+			return result, err
+		}
+	}
+
+	return AuthResult{Transient: true}, fmt.Errorf("users: http password auth provider unreachable after retries: %w", lastErr)
+}
+
+// doRequest performs a single attempt against the configured endpoint. The
+// transient return value distinguishes infrastructure failures (network
+// errors, timeouts, 5xx) from credential failures (401/403), which must not
+// be retried or treated as a bad password.
+func (a *httpAuthenticator) doRequest(ctx context.Context, body []byte) (AuthResult, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return AuthResult{}, false, fmt.Errorf("users: failed to build http auth request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+a.bearerToken)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return AuthResult{Transient: true}, true, fmt.Errorf("users: http auth provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		var parsed httpAuthResponse
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&parsed); err != nil {
+			return AuthResult{}, false, fmt.Errorf("users: malformed response from http auth provider: %w", err)
+		}
+		return AuthResult{Ok: parsed.Ok, ProviderUserID: parsed.ProviderUserID, Claims: parsed.Claims}, false, nil
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return AuthResult{Ok: false}, false, nil
+	case resp.StatusCode >= 500:
+		return AuthResult{Transient: true}, true, fmt.Errorf("users: http auth provider returned %d", resp.StatusCode)
+	default:
+		return AuthResult{Ok: false}, false, fmt.Errorf("users: http auth provider returned unexpected status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package users
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v6/model"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHTTPAuthenticator(t *testing.T, url string) *httpAuthenticator {
+	t.Helper()
+	return &httpAuthenticator{
+		client: &http.Client{Timeout: 200 * time.Millisecond},
+		url:    url,
+	}
+}
+
+func TestHTTPAuthenticatorAuthenticate(t *testing.T) {
+	t.Run("ok response", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"ok": true, "provider_user_id": "remote-1"}`))
+		}))
+		defer srv.Close()
+
+		result, err := newTestHTTPAuthenticator(t, srv.URL).Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.NoError(t, err)
+		require.True(t, result.Ok)
+		require.Equal(t, "remote-1", result.ProviderUserID)
+		require.False(t, result.Transient)
+	})
+
+	t.Run("401 is a credential failure, not transient", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer srv.Close()
+
+		result, err := newTestHTTPAuthenticator(t, srv.URL).Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.NoError(t, err)
+		require.False(t, result.Ok)
+		require.False(t, result.Transient)
+	})
+
+	t.Run("5xx is transient", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+
+		a := newTestHTTPAuthenticator(t, srv.URL)
+		a.maxRetries = 0
+		result, err := a.Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.Error(t, err)
+		require.True(t, result.Transient)
+	})
+
+	t.Run("timeout is transient", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+		}))
+		defer srv.Close()
+
+		a := newTestHTTPAuthenticator(t, srv.URL)
+		a.maxRetries = 0
+		result, err := a.Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.Error(t, err)
+		require.True(t, result.Transient)
+	})
+
+	t.Run("malformed JSON on 200 is not transient", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`not json`))
+		}))
+		defer srv.Close()
+
+		a := newTestHTTPAuthenticator(t, srv.URL)
+		a.maxRetries = 0
+		result, err := a.Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.Error(t, err)
+		require.False(t, result.Transient)
+	})
+
+	t.Run("missing url", func(t *testing.T) {
+		a := &httpAuthenticator{client: http.DefaultClient}
+		_, err := a.Authenticate(context.Background(), "user", "pass", &model.User{})
+		require.Error(t, err)
+	})
+}
+
+func TestRegisterPasswordAuthProvider(t *testing.T) {
+	const provider = PasswordAuthProvider("test-plugin")
+	called := false
+
+	RegisterPasswordAuthProvider(provider, func(us *UserService) PasswordAuthenticator {
+		called = true
+		return bcryptAuthenticator{}
+	})
+	defer delete(passwordAuthProviderRegistry, provider)
+
+	factory, ok := passwordAuthProviderRegistry[provider]
+	require.True(t, ok)
+
+	factory(nil)
+	require.True(t, called)
+}
+
+func TestBcryptAuthenticator(t *testing.T) {
+	user := &model.User{Password: HashPassword("Sup3rSecret!")}
+
+	result, err := bcryptAuthenticator{}.Authenticate(context.Background(), "user", "Sup3rSecret!", user)
+	require.NoError(t, err)
+	require.True(t, result.Ok)
+
+	result, err = bcryptAuthenticator{}.Authenticate(context.Background(), "user", "wrong", user)
+	require.NoError(t, err)
+	require.False(t, result.Ok)
+}